@@ -0,0 +1,96 @@
+package main
+
+import (
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/poly"
+)
+
+// Complaint is broadcast (via the client, the same way R2/R3 messages
+// are relayed) by an insurer whose share from a dealer failed
+// ProduceResponse, so every server - not just the complaining insurer -
+// gets a chance to see the dealer justify or fail to justify the share.
+type Complaint struct {
+	Dealer int
+	Index  int
+	Resp   []byte // marshaled poly.Response explaining the rejection
+}
+
+// Justification is a dealer's answer to a Complaint: the disputed share,
+// revealed in the clear so every server can verify for itself whether the
+// complaint was warranted.
+type Justification struct {
+	Dealer int
+	Index  int
+	Share  []byte // the disputed share's cleartext secret
+}
+
+// IComplaint carries, round-trip through the client, every server's
+// complaints for this session so each server can decide who to justify.
+type IComplaint struct {
+	Complaints []Complaint
+}
+
+// RComplaint is a server's own complaints for this round.
+type RComplaint struct {
+	Complaints []Complaint
+}
+
+// IJustify carries, round-trip through the client, every dealer's
+// justifications so each server can apply the disqualification rule.
+type IJustify struct {
+	Justifications []Justification
+}
+
+// RJustify is a server's own justifications for this round: one per
+// Complaint naming it as the dealer.
+type RJustify struct {
+	Justifications []Justification
+}
+
+// DisqualificationSet records, for a completed session, which dealers
+// were disqualified and the complaint/justification evidence behind that
+// decision, so the client and any outside auditor can recompute the same
+// verdict instead of trusting the servers' word for it.
+type DisqualificationSet struct {
+	Disqualified   map[int]bool
+	Complaints     []Complaint
+	Justifications []Justification
+}
+
+// disqualify applies the same rule on every server: a dealer is
+// disqualified if any complaint against it went unanswered by a matching,
+// *verified* Justification by the end of the round. deals holds the
+// dealer's Promise for every dealer index, the same ones every server
+// already unmarshaled out of R2 while processing I3 - without checking
+// the revealed Share against it, a cheating dealer could "answer" any
+// complaint with an arbitrary Justification and be vindicated regardless
+// of whether the share it reveals actually matches its public commitment.
+func disqualify(suite abstract.Suite, deals map[int]*poly.Promise, complaints []Complaint, justifications []Justification) DisqualificationSet {
+	answered := make(map[[2]int]bool, len(justifications))
+	for _, j := range justifications {
+		deal, ok := deals[j.Dealer]
+		if !ok {
+			continue // no Promise on file for this dealer; can't verify
+		}
+		share := suite.Secret()
+		if err := share.UnmarshalBinary(j.Share); err != nil {
+			continue // malformed share; treat as unanswered
+		}
+		if err := deal.VerifyRevealedShare(j.Index, share); err != nil {
+			continue // revealed share doesn't match the dealer's commitment
+		}
+		answered[[2]int{j.Dealer, j.Index}] = true
+	}
+
+	ds := DisqualificationSet{
+		Disqualified:   make(map[int]bool),
+		Complaints:     complaints,
+		Justifications: justifications,
+	}
+	for _, c := range complaints {
+		if !answered[[2]int{c.Dealer, c.Index}] {
+			ds.Disqualified[c.Dealer] = true
+		}
+	}
+	return ds
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/config"
+	"github.com/dedis/crypto/nist"
+	"github.com/dedis/crypto/poly"
+	"github.com/dedis/crypto/random"
+)
+
+// testDeal builds a Promise from dealerKey to the given insurer public
+// keys, the same way Server.serve does when constructing r2.Deal.
+func testDeal(suite abstract.Suite, dealerKey *config.KeyPair, insurerPub []abstract.Point) *poly.Promise {
+	secPair := &config.KeyPair{}
+	secPair.Gen(suite, random.Stream)
+	deal := &poly.Promise{}
+	deal.ConstructPromise(secPair, dealerKey, thresT, thresR, insurerPub)
+	return deal
+}
+
+func testInsurers(suite abstract.Suite, n int) ([]*config.KeyPair, []abstract.Point) {
+	keys := make([]*config.KeyPair, n)
+	pub := make([]abstract.Point, n)
+	for i := 0; i < n; i++ {
+		keys[i] = &config.KeyPair{}
+		keys[i].Gen(suite, random.Stream)
+		pub[i] = keys[i].Public
+	}
+	return keys, pub
+}
+
+// disqualify is a pure function of its arguments, so calling it more than
+// once on identical complaints/justifications models every honest server
+// in a session independently applying the same rule to the same evidence.
+func runOnAllServers(t *testing.T, nservers int, suite abstract.Suite, deals map[int]*poly.Promise, complaints []Complaint, justifications []Justification) DisqualificationSet {
+	var first DisqualificationSet
+	for s := 0; s < nservers; s++ {
+		ds := disqualify(suite, deals, complaints, justifications)
+		if s == 0 {
+			first = ds
+		} else if !reflect.DeepEqual(ds.Disqualified, first.Disqualified) {
+			t.Fatalf("server %d computed a different qualified set than server 0: %v vs %v", s, ds.Disqualified, first.Disqualified)
+		}
+	}
+	return first
+}
+
+func TestDisqualifyNoCheaters(t *testing.T) {
+	suite := nist.NewAES128SHA256P256()
+	_, insurerPub := testInsurers(suite, thresN)
+
+	deals := make(map[int]*poly.Promise)
+	for d := 0; d < thresN; d++ {
+		dealerKey := &config.KeyPair{}
+		dealerKey.Gen(suite, random.Stream)
+		deals[d] = testDeal(suite, dealerKey, insurerPub)
+	}
+
+	ds := runOnAllServers(t, thresN, suite, deals, nil, nil)
+	if len(ds.Disqualified) != 0 {
+		t.Fatalf("expected no disqualified dealers, got %v", ds.Disqualified)
+	}
+}
+
+func TestDisqualifyOneCheatingDealer(t *testing.T) {
+	suite := nist.NewAES128SHA256P256()
+	insurerKeys, insurerPub := testInsurers(suite, thresN)
+
+	deals := make(map[int]*poly.Promise)
+	for d := 0; d < thresN; d++ {
+		dealerKey := &config.KeyPair{}
+		dealerKey.Gen(suite, random.Stream)
+		deals[d] = testDeal(suite, dealerKey, insurerPub)
+	}
+
+	// Dealer 0's insurer 0 complains; dealer 0 never justifies.
+	complaints := []Complaint{{Dealer: 0, Index: 0}}
+
+	// Dealer 1's insurer 0 also complains, but dealer 1 justifies with its
+	// real, correctly-revealed share and should stay qualified.
+	share, err := deals[1].RevealShare(0, insurerKeys[0])
+	if err != nil {
+		t.Fatalf("RevealShare: %v", err)
+	}
+	complaints = append(complaints, Complaint{Dealer: 1, Index: 0})
+	justifications := []Justification{{Dealer: 1, Index: 0, Share: share}}
+
+	ds := runOnAllServers(t, thresN, suite, deals, complaints, justifications)
+	if !ds.Disqualified[0] {
+		t.Errorf("dealer 0 should be disqualified (never justified)")
+	}
+	if ds.Disqualified[1] {
+		t.Errorf("dealer 1 should stay qualified (justified correctly)")
+	}
+}
+
+func TestDisqualifyTwoCheatingDealers(t *testing.T) {
+	suite := nist.NewAES128SHA256P256()
+	insurerKeys, insurerPub := testInsurers(suite, thresN)
+
+	deals := make(map[int]*poly.Promise)
+	for d := 0; d < thresN; d++ {
+		dealerKey := &config.KeyPair{}
+		dealerKey.Gen(suite, random.Stream)
+		deals[d] = testDeal(suite, dealerKey, insurerPub)
+	}
+
+	// Dealer 0 never answers its complaint.
+	// Dealer 1 answers with a bogus share that doesn't match its Promise's
+	// public commitment; it should be disqualified just the same as if it
+	// hadn't answered at all.
+	bogusShare, err := deals[0].RevealShare(0, insurerKeys[0])
+	if err != nil {
+		t.Fatalf("RevealShare: %v", err)
+	}
+	complaints := []Complaint{
+		{Dealer: 0, Index: 0},
+		{Dealer: 1, Index: 0},
+	}
+	justifications := []Justification{
+		{Dealer: 1, Index: 0, Share: bogusShare}, // share from the wrong dealer's Promise
+	}
+
+	ds := runOnAllServers(t, thresN, suite, deals, complaints, justifications)
+	if !ds.Disqualified[0] {
+		t.Errorf("dealer 0 should be disqualified (never justified)")
+	}
+	if !ds.Disqualified[1] {
+		t.Errorf("dealer 1 should be disqualified (justified with a share that fails verification)")
+	}
+}
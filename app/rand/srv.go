@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"errors"
+	"github.com/dedis/cothority/lib/proof"
 	"github.com/dedis/crypto/abstract"
 	"github.com/dedis/crypto/config"
 	"github.com/dedis/crypto/poly"
@@ -50,7 +51,7 @@ func (s *Server) init(host Host, suite abstract.Suite,
 	s.self = self
 }
 
-func (s *Server) serve(conn Conn) (err error) {
+func (s *Server) serve(conn Conn) (ds DisqualificationSet, fraudProofs []proof.FraudProof, err error) {
 	s.conn = conn
 
 	// Receive client's I1
@@ -68,7 +69,7 @@ func (s *Server) serve(conn Conn) (err error) {
 	r1.HRs = abstract.Sum(s.suite, Rs)
 	err = s.send(&r1)
 	if err != nil {
-		return err
+		return ds, fraudProofs, err
 	}
 
 	// Receive client's I2
@@ -79,7 +80,7 @@ func (s *Server) serve(conn Conn) (err error) {
 	Rc := i2.Rc
 	HRc := abstract.Sum(s.suite, Rc)
 	if !bytes.Equal(HRc, i1.HRc) {
-		return errors.New("client random hash mismatch")
+		return ds, fraudProofs, errors.New("client random hash mismatch")
 	}
 
 	// Construct our Deal
@@ -90,9 +91,9 @@ func (s *Server) serve(conn Conn) (err error) {
 	for i := range sel {
 		selkeys[i] = s.srvpub[sel[i]].Point
 	}
-	deal := &poly.Promise{}
-	deal.ConstructPromise(secPair, &s.keypair, thresT, thresR, selkeys)
-	dealb, err := deal.MarshalBinary()
+	myDeal := &poly.Promise{}
+	myDeal.ConstructPromise(secPair, &s.keypair, thresT, thresR, selkeys)
+	dealb, err := myDeal.MarshalBinary()
 	if err != nil {
 		return
 	}
@@ -113,10 +114,12 @@ func (s *Server) serve(conn Conn) (err error) {
 	// Decrypt and validate all the shares we've been dealt.
 	nsrv := len(s.srvpub)
 	if len(i3.R2s) != nsrv {
-		return errors.New("wrong-length R2 array in I3 message")
+		return ds, fraudProofs, errors.New("wrong-length R2 array in I3 message")
 	}
 	shares := []R4Share{}
 	r3resps := []R3Resp{}
+	complaints := []Complaint{}
+	dealerPromises := make(map[int]*poly.Promise, nsrv)
 	for i := 0; i < nsrv; i++ {
 		r2i := R2{}
 		r2ib := i3.R2s[i]
@@ -134,6 +137,11 @@ func (s *Server) serve(conn Conn) (err error) {
 		if err = deal.UnmarshalBinary(r2i.Deal); err != nil {
 			return
 		}
+		// Keep every dealer's Promise around, not just the ones dealt to
+		// us: the justification round needs it to verify a dealer's
+		// revealed share against its public commitment, for dealers we
+		// never personally held a share from.
+		dealerPromises[i] = deal
 
 		// Which insurers did server i deal its secret to?
 		sel := pickInsurers(s.suite, s.srvpub, Rc, r2i.Rs)
@@ -142,12 +150,33 @@ func (s *Server) serve(conn Conn) (err error) {
 				continue // share dealt to someone else
 			}
 
-			// Decrypt and validate the specific share we were dealt
-			// XXX produce response rather than returning if invalid
-			share, resp, err := deal.ProduceResponse(
+			// Decrypt and validate the specific share we were dealt.
+			// ProduceResponse returns resp either way; on failure we
+			// turn it into a portable BadShareProof and move on to the
+			// next dealer instead of aborting the whole session.
+			share, resp, prodErr := deal.ProduceResponse(
 				k, &s.keypair)
-			if err != nil {
-				return err
+			if prodErr != nil {
+				respB, marshalErr := resp.MarshalBinary()
+				if marshalErr != nil {
+					return ds, fraudProofs, marshalErr
+				}
+				fraudProofs = append(fraudProofs, &proof.BadShareProof{
+					Dealer:   i,
+					Index:    k,
+					PromiseB: r2i.Deal,
+					RespB:    respB,
+					R2:       r2ib,
+					ThresT:   thresT,
+					ThresR:   thresR,
+					ThresN:   thresN,
+				})
+				// Broadcast a formal complaint instead of just privately
+				// recording a fraud proof, so every server gets a chance
+				// to see dealer i justify (or fail to justify) the share
+				// before it's disqualified.
+				complaints = append(complaints, Complaint{Dealer: i, Index: k, Resp: respB})
+				continue // don't include this dealer's share; keep serving
 			}
 
 			// Marshal the response to return to the client
@@ -156,7 +185,7 @@ func (s *Server) serve(conn Conn) (err error) {
 			r3resp.Index = k
 			r3resp.Resp, err = resp.MarshalBinary()
 			if err != nil {
-				return err
+				return ds, fraudProofs, err
 			}
 			r3resps = append(r3resps, r3resp)
 
@@ -172,7 +201,7 @@ func (s *Server) serve(conn Conn) (err error) {
 	r3 := R3{Resp: r3resps}
 	err = s.send(&r3)
 	if err != nil {
-		return err
+		return ds, fraudProofs, err
 	}
 
 	// Receive client's I4
@@ -183,18 +212,64 @@ func (s *Server) serve(conn Conn) (err error) {
 
 	// Validate the R4, mainly just making sure it's a subset of the R3 set
 	if len(i4.R2s) != nsrv {
-		return errors.New("wrong-length R2 array in I4 message")
+		return ds, fraudProofs, errors.New("wrong-length R2 array in I4 message")
 	}
 	for i := 0; i < nsrv; i++ {
 		r2ib := i4.R2s[i]
 		if len(r2ib) != 0 && !bytes.Equal(r2ib, i3.R2s[i]) {
-			return errors.New("R2 set in I4 not a subset of I3")
+			return ds, fraudProofs, errors.New("R2 set in I4 not a subset of I3")
+		}
+	}
+
+	// Complaint round: broadcast our complaints (if any) and receive back
+	// every server's, relayed the same way the client relays R2/R3.
+	err = s.send(&RComplaint{Complaints: complaints})
+	if err != nil {
+		return ds, fraudProofs, err
+	}
+	var ic IComplaint
+	if err = s.recv(&ic); err != nil {
+		return
+	}
+
+	// Justification round: answer every complaint naming us as the
+	// dealer by revealing the disputed share in the clear, then receive
+	// back every dealer's justifications.
+	myJustifications := []Justification{}
+	for _, c := range ic.Complaints {
+		if c.Dealer != s.self {
+			continue
+		}
+		share, justifyErr := myDeal.RevealShare(c.Index, &s.keypair)
+		if justifyErr != nil {
+			continue // can't justify; leave this complaint unanswered
+		}
+		myJustifications = append(myJustifications, Justification{
+			Dealer: c.Dealer, Index: c.Index, Share: share,
+		})
+	}
+	err = s.send(&RJustify{Justifications: myJustifications})
+	if err != nil {
+		return ds, fraudProofs, err
+	}
+	var ij IJustify
+	if err = s.recv(&ij); err != nil {
+		return
+	}
+
+	// Every honest server applies the same rule to the same evidence, so
+	// they all converge on the same qualified-dealer set independently.
+	ds = disqualify(s.suite, dealerPromises, ic.Complaints, ij.Justifications)
+	qualifiedShares := make([]R4Share, 0, len(shares))
+	for _, sh := range shares {
+		if !ds.Disqualified[sh.Dealer] {
+			qualifiedShares = append(qualifiedShares, sh)
 		}
 	}
 
 	// Send our R4
 	// XXX but only if our deal is still included?
-	r4 := R4{Shares: shares}
+	r4 := R4{Shares: qualifiedShares}
 	err = s.send(&r4)
 	if err != nil {
 		return
@@ -0,0 +1,219 @@
+// Package da adds Reed-Solomon erasure coding on top of a proof.Proof
+// Merkle tree, so that a light client can become confident a full block
+// is available without downloading it: it samples a handful of the
+// committed shards, and either gets valid inclusion proofs for all of
+// them (data is very likely recoverable) or is handed a BadEncodingProof
+// showing the commitment itself is malformed.
+package da
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/dedis/cothority/lib/hashid"
+	"github.com/dedis/cothority/lib/proof"
+	"github.com/klauspost/reedsolomon"
+)
+
+// EncodeAndCommit splits leaves into k data shards, computes n-k
+// Reed-Solomon parity shards, and commits to all n shards as a single
+// Merkle tree via proof.ProofTree.
+//
+// Reed-Solomon shards must all be the same size, but leaves need not be:
+// each data shard is prefixed with its original leaf's length (as a
+// uvarint) before being zero-padded out to shardSize, so Reconstruct can
+// recover the exact leaf boundaries instead of returning padding
+// indistinguishable from real data.
+func EncodeAndCommit(cfg proof.HashConfig, leaves []hashid.HashId, k, n int) (hashid.HashId, []hashid.HashId, []proof.Proof, error) {
+	if n <= k || k <= 0 {
+		return nil, nil, nil, errors.New("da: need 0 < k < n")
+	}
+	if len(leaves) > k {
+		return nil, nil, nil, errors.New("da: more leaves than data shards k")
+	}
+
+	prefixed := make([][]byte, len(leaves))
+	shardSize := 0
+	for i, l := range leaves {
+		buf := make([]byte, binary.MaxVarintLen64+len(l))
+		n := binary.PutUvarint(buf, uint64(len(l)))
+		buf = append(buf[:n], l...)
+		prefixed[i] = buf
+		if len(buf) > shardSize {
+			shardSize = len(buf)
+		}
+	}
+
+	shards := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		shards[i] = make([]byte, shardSize)
+		if i < len(prefixed) {
+			copy(shards[i], prefixed[i])
+		}
+	}
+
+	enc, err := reedsolomon.New(k, n-k)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := enc.Encode(shards); err != nil {
+		return nil, nil, nil, err
+	}
+
+	shardLeaves := make([]hashid.HashId, n)
+	for i, s := range shards {
+		shardLeaves[i] = hashid.HashId(s)
+	}
+
+	root, proofs := proof.ProofTree(cfg, shardLeaves)
+	return root, shardLeaves, proofs, nil
+}
+
+// SamplingProof is what a full node hands a light client in response to a
+// data-availability sample: the requested shards, each with its own
+// inclusion proof against the committed root.
+type SamplingProof struct {
+	Indices []int
+	Shards  []hashid.HashId
+	Proofs  []proof.Proof
+}
+
+// Sample gathers the shards and proofs for the requested indices into a
+// single SamplingProof for transmission to a light client.
+func Sample(indices []int, shards []hashid.HashId, proofs []proof.Proof) (SamplingProof, error) {
+	if len(shards) != len(proofs) {
+		return SamplingProof{}, errors.New("da: shards and proofs must have the same length")
+	}
+	sp := SamplingProof{Indices: indices}
+	for _, i := range indices {
+		if i < 0 || i >= len(shards) {
+			return SamplingProof{}, errors.New("da: sample index out of range")
+		}
+		sp.Shards = append(sp.Shards, shards[i])
+		sp.Proofs = append(sp.Proofs, proofs[i])
+	}
+	return sp, nil
+}
+
+// Verify checks every sampled shard's inclusion proof against root. A
+// light client that samples enough indices and sees Verify succeed can be
+// confident, with high probability, that the full block is either
+// available or that the commitment itself must be malformed (in which
+// case a full node should be able to produce a BadEncodingProof).
+func (sp SamplingProof) Verify(cfg proof.HashConfig, root hashid.HashId) bool {
+	if len(sp.Indices) != len(sp.Shards) || len(sp.Indices) != len(sp.Proofs) {
+		return false
+	}
+	for i := range sp.Indices {
+		if !sp.Proofs[i].Check(cfg, root, sp.Shards[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Reconstruct rebuilds the original k data shards from whatever shards
+// are available (nil entries in shards mark the missing ones), after
+// checking every available shard against root via its proof.
+func Reconstruct(cfg proof.HashConfig, root hashid.HashId, k, n int, shards [][]byte, proofs []proof.Proof) ([]hashid.HashId, error) {
+	if len(shards) != n || len(proofs) != n {
+		return nil, errors.New("da: shards and proofs must each have length n")
+	}
+	for i, s := range shards {
+		if s == nil {
+			continue
+		}
+		if !proofs[i].Check(cfg, root, s) {
+			return nil, errors.New("da: shard failed to verify against root")
+		}
+	}
+
+	enc, err := reedsolomon.New(k, n-k)
+	if err != nil {
+		return nil, err
+	}
+	if err := enc.Reconstruct(shards); err != nil {
+		return nil, err
+	}
+
+	leaves := make([]hashid.HashId, k)
+	for i := 0; i < k; i++ {
+		leafLen, nb := binary.Uvarint(shards[i])
+		if nb <= 0 || int(leafLen) > len(shards[i])-nb {
+			return nil, errors.New("da: reconstructed shard has an invalid length prefix")
+		}
+		leaves[i] = hashid.HashId(shards[i][nb : nb+int(leafLen)])
+	}
+	return leaves, nil
+}
+
+// BadEncodingProof demonstrates that a committed shard set is not a
+// valid Reed-Solomon encoding of anything: reconstructing from two
+// different k-sized subsets of verified shards yields different values
+// for an index both subsets can reconstruct, so no single original block
+// could have produced the committed root. A full node builds one of
+// these instead of having to transmit the whole block to prove it's
+// broken.
+type BadEncodingProof struct {
+	K, N int
+	Root hashid.HashId
+
+	IdxA    []int
+	ShardsA [][]byte
+	ProofsA []proof.Proof
+
+	IdxB    []int
+	ShardsB [][]byte
+	ProofsB []proof.Proof
+}
+
+// Verify checks that both shard sets verify against Root, that each has
+// at least K shards, and that reconstructing the full shard list from
+// each set disagrees at some index - proving the commitment is
+// inconsistent with any valid encoding.
+func (bp *BadEncodingProof) Verify(cfg proof.HashConfig) error {
+	if len(bp.IdxA) < bp.K || len(bp.IdxB) < bp.K {
+		return errors.New("da: need at least K verified shards in each set")
+	}
+
+	full := func(idx []int, data [][]byte, proofs []proof.Proof) ([][]byte, error) {
+		if len(idx) != len(data) || len(idx) != len(proofs) {
+			return nil, errors.New("da: index, shard and proof lists must have the same length")
+		}
+		shards := make([][]byte, bp.N)
+		for i, pos := range idx {
+			if pos < 0 || pos >= bp.N {
+				return nil, errors.New("da: shard index out of range")
+			}
+			if !proofs[i].Check(cfg, bp.Root, data[i]) {
+				return nil, errors.New("da: shard failed to verify against root")
+			}
+			shards[pos] = data[i]
+		}
+		enc, err := reedsolomon.New(bp.K, bp.N-bp.K)
+		if err != nil {
+			return nil, err
+		}
+		if err := enc.Reconstruct(shards); err != nil {
+			return nil, err
+		}
+		return shards, nil
+	}
+
+	shardsA, err := full(bp.IdxA, bp.ShardsA, bp.ProofsA)
+	if err != nil {
+		return err
+	}
+	shardsB, err := full(bp.IdxB, bp.ShardsB, bp.ProofsB)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < bp.N; i++ {
+		if !bytes.Equal(shardsA[i], shardsB[i]) {
+			return nil // disagreement found: proof is good
+		}
+	}
+	return errors.New("da: both subsets reconstruct the same data; no inconsistency demonstrated")
+}
@@ -0,0 +1,163 @@
+package da
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/dedis/cothority/lib/hashid"
+	"github.com/dedis/cothority/lib/proof"
+)
+
+func testLeaves() []hashid.HashId {
+	return []hashid.HashId{
+		hashid.HashId("short"),
+		hashid.HashId(""),
+		hashid.HashId("a somewhat longer leaf than the others"),
+	}
+}
+
+func TestEncodeSampleVerifyRoundTrip(t *testing.T) {
+	cfg := proof.DefaultHashConfig(sha256.New)
+	leaves := testLeaves()
+	k, n := 4, 6
+
+	root, shards, proofs, err := EncodeAndCommit(cfg, leaves, k, n)
+	if err != nil {
+		t.Fatalf("EncodeAndCommit: %v", err)
+	}
+
+	sp, err := Sample([]int{0, 2, 5}, shards, proofs)
+	if err != nil {
+		t.Fatalf("Sample: %v", err)
+	}
+	if !sp.Verify(cfg, root) {
+		t.Fatal("SamplingProof.Verify failed on an untampered sample")
+	}
+
+	// Tamper with a sampled shard: verification must fail.
+	tampered := sp
+	tampered.Shards = append([]hashid.HashId{}, sp.Shards...)
+	tampered.Shards[0] = append(hashid.HashId{}, sp.Shards[0]...)
+	tampered.Shards[0][0] ^= 0xff
+	if tampered.Verify(cfg, root) {
+		t.Error("SamplingProof.Verify succeeded on a tampered shard")
+	}
+}
+
+func TestEncodeReconstructRoundTrip(t *testing.T) {
+	cfg := proof.DefaultHashConfig(sha256.New)
+	leaves := testLeaves() // includes a zero-length and unequal-length leaf
+	k, n := 4, 6
+
+	root, shards, proofs, err := EncodeAndCommit(cfg, leaves, k, n)
+	if err != nil {
+		t.Fatalf("EncodeAndCommit: %v", err)
+	}
+
+	// Drop n-k shards (simulate missing data) and reconstruct from the rest.
+	present := [][]byte{nil, []byte(shards[1]), nil, []byte(shards[3]), []byte(shards[4]), []byte(shards[5])}
+
+	got, err := Reconstruct(cfg, root, k, n, present, proofs)
+	if err != nil {
+		t.Fatalf("Reconstruct: %v", err)
+	}
+	if len(got) != len(leaves) {
+		t.Fatalf("got %d leaves, want %d", len(got), len(leaves))
+	}
+	for i := range leaves {
+		if !bytes.Equal(got[i], leaves[i]) {
+			t.Errorf("leaf %d: got %q, want %q", i, got[i], leaves[i])
+		}
+	}
+}
+
+func TestReconstructRejectsTamperedShard(t *testing.T) {
+	cfg := proof.DefaultHashConfig(sha256.New)
+	leaves := testLeaves()
+	k, n := 4, 6
+
+	root, shards, proofs, err := EncodeAndCommit(cfg, leaves, k, n)
+	if err != nil {
+		t.Fatalf("EncodeAndCommit: %v", err)
+	}
+
+	present := make([][]byte, n)
+	for i, s := range shards {
+		present[i] = []byte(s)
+	}
+	present[1][0] ^= 0xff // tamper with a shard that still carries its original proof
+
+	if _, err := Reconstruct(cfg, root, k, n, present, proofs); err == nil {
+		t.Fatal("Reconstruct accepted a shard that doesn't match its proof")
+	}
+}
+
+func TestBadEncodingProofValidEncodingDoesNotFalsePositive(t *testing.T) {
+	cfg := proof.DefaultHashConfig(sha256.New)
+	leaves := testLeaves()
+	k, n := 4, 6
+
+	root, shards, proofs, err := EncodeAndCommit(cfg, leaves, k, n)
+	if err != nil {
+		t.Fatalf("EncodeAndCommit: %v", err)
+	}
+
+	idxA := []int{0, 1, 2, 3}
+	idxB := []int{2, 3, 4, 5}
+	shardsA := make([][]byte, len(idxA))
+	proofsA := make([]proof.Proof, len(idxA))
+	for i, idx := range idxA {
+		shardsA[i] = []byte(shards[idx])
+		proofsA[i] = proofs[idx]
+	}
+	shardsB := make([][]byte, len(idxB))
+	proofsB := make([]proof.Proof, len(idxB))
+	for i, idx := range idxB {
+		shardsB[i] = []byte(shards[idx])
+		proofsB[i] = proofs[idx]
+	}
+
+	bp := &BadEncodingProof{
+		K: k, N: n, Root: root,
+		IdxA: idxA, ShardsA: shardsA, ProofsA: proofsA,
+		IdxB: idxB, ShardsB: shardsB, ProofsB: proofsB,
+	}
+	if err := bp.Verify(cfg); err == nil {
+		t.Fatal("BadEncodingProof.Verify succeeded against a genuinely valid encoding")
+	}
+}
+
+func TestBadEncodingProofDetectsInconsistentCommitment(t *testing.T) {
+	cfg := proof.DefaultHashConfig(sha256.New)
+	k, n := 2, 4
+
+	// Build a shard set by hand where index 2 (a "parity" shard) doesn't
+	// actually agree with the Reed-Solomon encoding of shards 0 and 1, so
+	// no single original block could have produced this commitment.
+	shardLen := 8
+	mk := func(b byte) []byte {
+		s := make([]byte, shardLen)
+		for i := range s {
+			s[i] = b
+		}
+		return s
+	}
+	shards := [][]byte{mk(1), mk(2), mk(0xff), mk(0xee)}
+	shardLeaves := make([]hashid.HashId, n)
+	for i, s := range shards {
+		shardLeaves[i] = hashid.HashId(s)
+	}
+	root, proofs := proof.ProofTree(cfg, shardLeaves)
+
+	idxA := []int{0, 1} // the data shards themselves: reconstruction is trivial
+	idxB := []int{0, 2} // one data shard plus the inconsistent "parity" shard
+	bp := &BadEncodingProof{
+		K: k, N: n, Root: root,
+		IdxA: idxA, ShardsA: [][]byte{shards[0], shards[1]}, ProofsA: []proof.Proof{proofs[0], proofs[1]},
+		IdxB: idxB, ShardsB: [][]byte{shards[0], shards[2]}, ProofsB: []proof.Proof{proofs[0], proofs[2]},
+	}
+	if err := bp.Verify(cfg); err != nil {
+		t.Fatalf("BadEncodingProof.Verify failed to detect an inconsistent commitment: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package proof
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"hash"
+
+	"github.com/dedis/cothority/lib/hashid"
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/poly"
+	"github.com/dedis/crypto/sig"
+)
+
+// FraudProof is a small, self-contained certificate that a signer
+// misbehaved, checkable by any third party who holds nothing more than
+// the signer's signed root. Producing one should never require anything
+// the accuser wouldn't already have on hand from the normal protocol run.
+type FraudProof interface {
+	Verify(suite abstract.Suite, srvpub sig.SchnorrPublicKey, clipub sig.PublicKey) error
+}
+
+// BadMerkleProof proves that a signer served two inconsistent Proofs
+// against the one root it signed: recomputing them yields different
+// roots, so at least one of the two was never actually included in the
+// tree the signer committed to.
+type BadMerkleProof struct {
+	Root      hashid.HashId // the root the signer signed
+	Signature []byte        // signer's signature over Root
+	LeafA     hashid.HashId
+	ProofA    Proof
+	LeafB     hashid.HashId
+	ProofB    Proof
+}
+
+// Verify checks srvpub's signature over Root, then confirms ProofA and
+// ProofB recompute to different roots while at least one of them claims
+// to recompute to the signed Root - i.e. the signer handed out a proof
+// that doesn't actually check out against what it signed.
+func (bp *BadMerkleProof) Verify(suite abstract.Suite, srvpub sig.SchnorrPublicKey, _ sig.PublicKey) error {
+	if err := srvpub.Verify(bp.Signature, bp.Root); err != nil {
+		return errors.New("fraud proof: signer's signature over Root does not verify")
+	}
+	cfg := DefaultHashConfig(func() hash.Hash { return suite.Hash() })
+	rootA := bp.ProofA.Calc(cfg, bp.LeafA)
+	rootB := bp.ProofB.Calc(cfg, bp.LeafB)
+	if bytes.Equal(rootA, rootB) {
+		return errors.New("fraud proof: the two proofs agree, no misbehavior demonstrated")
+	}
+	if !bytes.Equal(rootA, bp.Root) && !bytes.Equal(rootB, bp.Root) {
+		return errors.New("fraud proof: neither proof recomputes to the signed root")
+	}
+	return nil
+}
+
+// BadShareProof proves that a dealer's Promise dealt an insurer a share
+// that fails to decrypt and verify the way the Promise claims it should.
+// It carries everything a third party needs to replay the rejection
+// without trusting the insurer's word: the Promise the dealer dealt out,
+// the raw signed R2 message it came from (so Verify can bind PromiseB to
+// the accused Dealer itself, rather than trusting the caller's word that
+// the two belong together), and the Response the insurer produced when it
+// tried - and failed - to accept the share.
+type BadShareProof struct {
+	Dealer   int    // index of the accused dealer among the server set
+	Index    int    // insurer index within the dealer's Promise
+	PromiseB []byte // marshaled poly.Promise the dealer dealt out
+	RespB    []byte // insurer's poly.Response recording the failed share
+	R2       []byte // the dealer's signed R2 wire message PromiseB was extracted from
+	ThresT   int
+	ThresR   int
+	ThresN   int
+}
+
+// r2Envelope follows the wire convention assumed for sigEncode, which
+// app/rand calls but which is not defined in this tree: gob-encode the
+// payload, then sign the encoded bytes. r2Wire mirrors the
+// fields of main.R2 (Rs, Deal). Neither can be the real types - R2 lives
+// in package main alongside sigEncode/sigDecode, and main packages can't
+// be imported - but a struct with the same exported field names round-
+// trips through gob regardless of which package declares it, so decoding
+// into these local equivalents is enough to bind this proof to the
+// dealer's actual signed message.
+type r2Envelope struct {
+	Sig  []byte
+	Data []byte
+}
+
+type r2Wire struct {
+	Rs   []byte
+	Deal []byte
+}
+
+// decodeR2 verifies srvpub's signature over the R2 envelope and returns
+// the decoded payload, the same two steps the sigDecode call in
+// Server.serve performs on each dealer's R2.
+func decodeR2(srvpub sig.SchnorrPublicKey, msg []byte) (r2Wire, error) {
+	var env r2Envelope
+	if err := gob.NewDecoder(bytes.NewReader(msg)).Decode(&env); err != nil {
+		return r2Wire{}, errors.New("fraud proof: R2 envelope does not decode")
+	}
+	if err := srvpub.Verify(env.Sig, env.Data); err != nil {
+		return r2Wire{}, errors.New("fraud proof: R2 signature does not verify under srvpub")
+	}
+	var r2 r2Wire
+	if err := gob.NewDecoder(bytes.NewReader(env.Data)).Decode(&r2); err != nil {
+		return r2Wire{}, errors.New("fraud proof: R2 payload does not decode")
+	}
+	return r2, nil
+}
+
+// Verify unmarshals the Promise and Response and replays the Promise's
+// own verification of that Response, confirming the insurer was telling
+// the truth and the dealer really did deal a bad share. It also decodes
+// R2 under srvpub and checks the Deal it carries matches PromiseB, so the
+// proof is actually bound to the accused dealer rather than to an
+// unrelated Promise/Response pair the caller could have fabricated.
+func (bp *BadShareProof) Verify(suite abstract.Suite, srvpub sig.SchnorrPublicKey, clipub sig.PublicKey) error {
+	r2, err := decodeR2(srvpub, bp.R2)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(r2.Deal, bp.PromiseB) {
+		return errors.New("fraud proof: R2's Deal does not match PromiseB; proof not bound to accused dealer")
+	}
+
+	deal := &poly.Promise{}
+	deal.UnmarshalInit(bp.ThresT, bp.ThresR, bp.ThresN, suite)
+	if err := deal.UnmarshalBinary(bp.PromiseB); err != nil {
+		return errors.New("fraud proof: dealer's Promise does not unmarshal")
+	}
+
+	resp := &poly.Response{}
+	if err := resp.UnmarshalBinary(bp.RespB); err != nil {
+		return errors.New("fraud proof: insurer's Response does not unmarshal")
+	}
+
+	// VerifyResponse replays, using only public information, the same
+	// check the dealer itself would run on a complaint: if it comes back
+	// clean the share was actually fine and the insurer lied.
+	if err := deal.VerifyResponse(bp.Index, resp); err == nil {
+		return errors.New("fraud proof: share at Index actually verifies; dealer did not cheat")
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package proof
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"hash"
+	"testing"
+
+	"github.com/dedis/cothority/lib/hashid"
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/config"
+	"github.com/dedis/crypto/nist"
+	"github.com/dedis/crypto/poly"
+	"github.com/dedis/crypto/random"
+)
+
+// fakeSchnorrPublicKey stands in for sig.SchnorrPublicKey, which this
+// package can't construct directly: github.com/dedis/crypto/sig isn't
+// vendored in this tree, and neither is this repo's own sigEncode/
+// sigDecode pair (app/rand/srv.go calls them, but their definitions
+// aren't part of this trimmed snapshot, and they live in package main
+// anyway, which lib/proof can't import). It implements the one method
+// this package actually calls, Verify(sig, msg) error, so decodeR2 and
+// BadMerkleProof.Verify can be exercised against the exact contract they
+// depend on without needing the real package.
+type fakeSchnorrPublicKey struct {
+	wantSig, wantMsg []byte
+}
+
+func (f fakeSchnorrPublicKey) Verify(signature, message []byte) error {
+	if bytes.Equal(signature, f.wantSig) && bytes.Equal(message, f.wantMsg) {
+		return nil
+	}
+	return errors.New("fake: signature does not verify")
+}
+
+// buildR2 gob-encodes an r2Wire payload and wraps it in the r2Envelope
+// shape decodeR2 expects, "signing" it with sig so the returned pubkey
+// accepts it. This models sigEncode's assumed convention; see the comment
+// on r2Envelope in fraudproof.go.
+func buildR2(t *testing.T, rs, deal []byte, sig []byte) ([]byte, fakeSchnorrPublicKey) {
+	var dataBuf bytes.Buffer
+	if err := gob.NewEncoder(&dataBuf).Encode(r2Wire{Rs: rs, Deal: deal}); err != nil {
+		t.Fatalf("encode r2Wire: %v", err)
+	}
+	data := dataBuf.Bytes()
+
+	var envBuf bytes.Buffer
+	if err := gob.NewEncoder(&envBuf).Encode(r2Envelope{Sig: sig, Data: data}); err != nil {
+		t.Fatalf("encode r2Envelope: %v", err)
+	}
+	return envBuf.Bytes(), fakeSchnorrPublicKey{wantSig: sig, wantMsg: data}
+}
+
+func TestDecodeR2RoundTrip(t *testing.T) {
+	msg, pub := buildR2(t, []byte("rs-bytes"), []byte("deal-bytes"), []byte("valid-sig"))
+
+	r2, err := decodeR2(pub, msg)
+	if err != nil {
+		t.Fatalf("decodeR2: %v", err)
+	}
+	if !bytes.Equal(r2.Rs, []byte("rs-bytes")) || !bytes.Equal(r2.Deal, []byte("deal-bytes")) {
+		t.Fatalf("decodeR2 returned %+v, want Rs=rs-bytes Deal=deal-bytes", r2)
+	}
+}
+
+func TestDecodeR2TamperedSignature(t *testing.T) {
+	msg, pub := buildR2(t, []byte("rs-bytes"), []byte("deal-bytes"), []byte("valid-sig"))
+	pub.wantSig = []byte("a-different-sig") // simulate a signature that doesn't match the payload
+
+	if _, err := decodeR2(pub, msg); err == nil {
+		t.Fatal("decodeR2 accepted a message whose signature does not verify")
+	}
+}
+
+func TestDecodeR2MalformedEnvelope(t *testing.T) {
+	pub := fakeSchnorrPublicKey{}
+	if _, err := decodeR2(pub, []byte("not a gob envelope")); err == nil {
+		t.Fatal("decodeR2 accepted a malformed envelope")
+	}
+}
+
+func TestBadShareProofRejectsMismatchedDeal(t *testing.T) {
+	msg, pub := buildR2(t, []byte("rs"), []byte("deal-from-r2"), []byte("sig"))
+	bp := &BadShareProof{
+		Dealer:   0,
+		Index:    0,
+		PromiseB: []byte("a-different-promise"),
+		RespB:    nil,
+		R2:       msg,
+		ThresT:   2, ThresR: 2, ThresN: 3,
+	}
+	suite := nist.NewAES128SHA256P256()
+	if err := bp.Verify(suite, pub, nil); err == nil {
+		t.Fatal("Verify accepted a PromiseB that doesn't match R2's Deal")
+	}
+}
+
+func TestBadShareProofVerifyRejectsActuallyValidShare(t *testing.T) {
+	suite := nist.NewAES128SHA256P256()
+	thresT, thresR, thresN := 2, 2, 3
+
+	dealerKey := &config.KeyPair{}
+	dealerKey.Gen(suite, random.Stream)
+
+	insurerKeys := make([]*config.KeyPair, thresN)
+	insurerPoints := make([]abstract.Point, thresN)
+	for i := 0; i < thresN; i++ {
+		insurerKeys[i] = &config.KeyPair{}
+		insurerKeys[i].Gen(suite, random.Stream)
+		insurerPoints[i] = insurerKeys[i].Public
+	}
+
+	secPair := &config.KeyPair{}
+	secPair.Gen(suite, random.Stream)
+	deal := &poly.Promise{}
+	deal.ConstructPromise(secPair, dealerKey, thresT, thresR, insurerPoints)
+
+	dealB, err := deal.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+
+	_, resp, prodErr := deal.ProduceResponse(0, insurerKeys[0])
+	if prodErr != nil {
+		t.Fatalf("ProduceResponse: %v (expected a valid share for this test)", prodErr)
+	}
+	respB, err := resp.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Response.MarshalBinary: %v", err)
+	}
+
+	msg, pub := buildR2(t, []byte("rs"), dealB, []byte("sig"))
+	bp := &BadShareProof{
+		Dealer:   0,
+		Index:    0,
+		PromiseB: dealB,
+		RespB:    respB,
+		R2:       msg,
+		ThresT:   thresT, ThresR: thresR, ThresN: thresN,
+	}
+	if err := bp.Verify(suite, pub, nil); err == nil {
+		t.Fatal("Verify accepted a BadShareProof over a share that actually verifies fine")
+	}
+}
+
+func TestBadMerkleProofVerify(t *testing.T) {
+	suite := nist.NewAES128SHA256P256()
+	cfg := DefaultHashConfig(func() hash.Hash { return sha256.New() })
+	leavesA := []hashid.HashId{hashid.HashId("leaf-a-0"), hashid.HashId("leaf-a-1")}
+	rootA, proofsA := ProofTree(cfg, leavesA)
+
+	leavesB := []hashid.HashId{hashid.HashId("leaf-b-0"), hashid.HashId("leaf-b-1")}
+	_, proofsB := ProofTree(cfg, leavesB)
+
+	sig := []byte("root-signature")
+	pub := fakeSchnorrPublicKey{wantSig: sig, wantMsg: rootA}
+
+	// Positive: ProofA recomputes to the signed root, ProofB (from a
+	// different tree) recomputes to something else - misbehavior.
+	bad := &BadMerkleProof{
+		Root: rootA, Signature: sig,
+		LeafA: leavesA[0], ProofA: proofsA[0],
+		LeafB: leavesB[0], ProofB: proofsB[0],
+	}
+	if err := bad.Verify(suite, pub, nil); err != nil {
+		t.Fatalf("Verify rejected a genuine inconsistency: %v", err)
+	}
+
+	// Negative: both proofs come from the same tree and agree - no fraud.
+	good := &BadMerkleProof{
+		Root: rootA, Signature: sig,
+		LeafA: leavesA[0], ProofA: proofsA[0],
+		LeafB: leavesA[1], ProofB: proofsA[1],
+	}
+	if err := good.Verify(suite, pub, nil); err == nil {
+		t.Fatal("Verify accepted two consistent proofs as a fraud proof")
+	}
+}
@@ -0,0 +1,327 @@
+package proof
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/dedis/cothority/lib/hashid"
+)
+
+// SignedTreeHead is an append-only log's head commitment: the log's
+// current size and root hash, meant to be signed by the log operator the
+// same way any other Merkle root in this package would be.
+type SignedTreeHead struct {
+	TreeSize uint64
+	RootHash hashid.HashId
+}
+
+// ConsistencyProof is PROOF(oldSize, D[newSize]) in RFC 6962 terms: the
+// hashes needed to prove a log of newSize entries is an append-only
+// extension of one of oldSize entries.
+type ConsistencyProof []hashid.HashId
+
+// LogStorage is the minimal persistence interface MerkleLog needs. It can
+// be backed by memory, a file, or a KV store; MerkleLog only ever asks
+// for entries by their zero-based leaf index, one entry at a time.
+type LogStorage interface {
+	Append(entry []byte) error
+	Get(index uint64) ([]byte, error)
+	Len() (uint64, error)
+}
+
+// MemoryLogStorage is the simplest LogStorage: entries held in a slice.
+type MemoryLogStorage struct {
+	entries [][]byte
+}
+
+func NewMemoryLogStorage() *MemoryLogStorage {
+	return &MemoryLogStorage{}
+}
+
+func (m *MemoryLogStorage) Append(entry []byte) error {
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *MemoryLogStorage) Get(index uint64) ([]byte, error) {
+	if index >= uint64(len(m.entries)) {
+		return nil, errors.New("merklelog: index out of range")
+	}
+	return m.entries[index], nil
+}
+
+func (m *MemoryLogStorage) Len() (uint64, error) {
+	return uint64(len(m.entries)), nil
+}
+
+// MerkleLog is an append-only, Certificate-Transparency-style log: each
+// entry is a leaf hashed with the same leaf/node domain separation as
+// proof.ProofTree (RFC 6962 subtree hashing). TileSize is stored but no
+// MerkleLog method reads it: each entry goes to Storage on its own, no
+// tiles are written, and subtree hashes are recomputed from the stored
+// entries on every call rather than cached.
+type MerkleLog struct {
+	Cfg      HashConfig
+	Storage  LogStorage
+	TileSize int // leaves per tile, e.g. 256
+}
+
+// NewMerkleLog returns a MerkleLog backed by storage. tileSize <= 0
+// defaults to 256.
+func NewMerkleLog(cfg HashConfig, storage LogStorage, tileSize int) *MerkleLog {
+	if tileSize <= 0 {
+		tileSize = 256
+	}
+	return &MerkleLog{Cfg: cfg, Storage: storage, TileSize: tileSize}
+}
+
+// Append adds entry to the log and returns its index and the log's new
+// SignedTreeHead.
+func (l *MerkleLog) Append(entry []byte) (uint64, SignedTreeHead, error) {
+	if err := l.Storage.Append(entry); err != nil {
+		return 0, SignedTreeHead{}, err
+	}
+	n, err := l.Storage.Len()
+	if err != nil {
+		return 0, SignedTreeHead{}, err
+	}
+	sth, err := l.sth(n)
+	return n - 1, sth, err
+}
+
+// GetSTH returns the SignedTreeHead for the log's current size.
+func (l *MerkleLog) GetSTH() (SignedTreeHead, error) {
+	n, err := l.Storage.Len()
+	if err != nil {
+		return SignedTreeHead{}, err
+	}
+	return l.sth(n)
+}
+
+func (l *MerkleLog) sth(n uint64) (SignedTreeHead, error) {
+	root, err := l.subtreeHash(0, n)
+	if err != nil {
+		return SignedTreeHead{}, err
+	}
+	return SignedTreeHead{TreeSize: n, RootHash: root}, nil
+}
+
+// largestPowerOfTwoLessThan returns the largest power of two strictly
+// less than n, per RFC 6962's split rule for n > 1.
+func largestPowerOfTwoLessThan(n uint64) uint64 {
+	k := uint64(1)
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// subtreeHash computes RFC 6962's MTH over the leaves [start, end).
+func (l *MerkleLog) subtreeHash(start, end uint64) (hashid.HashId, error) {
+	c := hashContext{cfg: l.Cfg}
+	n := end - start
+	if n == 0 {
+		return c.reset().Sum(nil), nil
+	}
+	if n == 1 {
+		e, err := l.Storage.Get(start)
+		if err != nil {
+			return nil, err
+		}
+		return c.hashLeaf(nil, e), nil
+	}
+	k := largestPowerOfTwoLessThan(n)
+	left, err := l.subtreeHash(start, start+k)
+	if err != nil {
+		return nil, err
+	}
+	right, err := l.subtreeHash(start+k, end)
+	if err != nil {
+		return nil, err
+	}
+	return c.hashNode(nil, left, right), nil
+}
+
+// InclusionProof returns the RFC 6962 PATH(index, D[treeSize]) proof that
+// the entry at index is included in the tree of the first treeSize
+// entries.
+func (l *MerkleLog) InclusionProof(index, treeSize uint64) (Proof, error) {
+	if treeSize == 0 || index >= treeSize {
+		return nil, errors.New("merklelog: index out of range for tree size")
+	}
+	return l.path(index, 0, treeSize)
+}
+
+func (l *MerkleLog) path(m, start, n uint64) (Proof, error) {
+	if n == 1 {
+		return Proof{}, nil
+	}
+	k := largestPowerOfTwoLessThan(n)
+	if m < k {
+		sib, err := l.subtreeHash(start+k, start+n)
+		if err != nil {
+			return nil, err
+		}
+		sub, err := l.path(m, start, k)
+		if err != nil {
+			return nil, err
+		}
+		return append(Proof{{Hash: sib, Left: false}}, sub...), nil
+	}
+	sib, err := l.subtreeHash(start, start+k)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := l.path(m-k, start+k, n-k)
+	if err != nil {
+		return nil, err
+	}
+	return append(Proof{{Hash: sib, Left: true}}, sub...), nil
+}
+
+// ConsistencyProof returns RFC 6962's PROOF(oldSize, D[newSize]).
+func (l *MerkleLog) ConsistencyProof(oldSize, newSize uint64) (ConsistencyProof, error) {
+	if oldSize == 0 || oldSize > newSize {
+		return nil, errors.New("merklelog: invalid sizes for consistency proof")
+	}
+	if oldSize == newSize {
+		return ConsistencyProof{}, nil
+	}
+	hashes, err := l.subProof(oldSize, 0, newSize, true)
+	return ConsistencyProof(hashes), err
+}
+
+// subProof implements RFC 6962's SUBPROOF(m, D[start:start+n], b).
+func (l *MerkleLog) subProof(m, start, n uint64, b bool) ([]hashid.HashId, error) {
+	if m == n {
+		if b {
+			return nil, nil
+		}
+		root, err := l.subtreeHash(start, start+n)
+		if err != nil {
+			return nil, err
+		}
+		return []hashid.HashId{root}, nil
+	}
+	k := largestPowerOfTwoLessThan(n)
+	if m <= k {
+		sub, err := l.subProof(m, start, k, b)
+		if err != nil {
+			return nil, err
+		}
+		sib, err := l.subtreeHash(start+k, start+n)
+		if err != nil {
+			return nil, err
+		}
+		return append(sub, sib), nil
+	}
+	sub, err := l.subProof(m-k, start+k, n-k, false)
+	if err != nil {
+		return nil, err
+	}
+	sib, err := l.subtreeHash(start, start+k)
+	if err != nil {
+		return nil, err
+	}
+	return append(sub, sib), nil
+}
+
+// GetProofByHash scans the first treeSize entries for one whose
+// leaf-tagged hash is entryHash and returns its index and inclusion
+// proof, for auditors who only hold a hash, not a position.
+func (l *MerkleLog) GetProofByHash(entryHash hashid.HashId, treeSize uint64) (uint64, Proof, error) {
+	c := hashContext{cfg: l.Cfg}
+	for i := uint64(0); i < treeSize; i++ {
+		e, err := l.Storage.Get(i)
+		if err != nil {
+			return 0, nil, err
+		}
+		if bytes.Equal(c.hashLeaf(nil, e), entryHash) {
+			p, err := l.InclusionProof(i, treeSize)
+			return i, p, err
+		}
+	}
+	return 0, nil, errors.New("merklelog: entry hash not found in given tree size")
+}
+
+// VerifyInclusion checks that entry is the leaf at index in the tree
+// committed to by sth, using p.
+func VerifyInclusion(cfg HashConfig, sth SignedTreeHead, entry []byte, index uint64, p Proof) bool {
+	if index >= sth.TreeSize {
+		return false
+	}
+	// Each step's side must follow the RFC 6962 path to index, so a proof
+	// for another position is not accepted for this one.
+	m, n := index, sth.TreeSize
+	for _, step := range p {
+		if n <= 1 || step.Left != (m >= largestPowerOfTwoLessThan(n)) {
+			return false
+		}
+		if k := largestPowerOfTwoLessThan(n); m < k {
+			n = k
+		} else {
+			m, n = m-k, n-k
+		}
+	}
+	if n != 1 {
+		return false
+	}
+	return p.Check(cfg, sth.RootHash, entry)
+}
+
+// VerifyConsistency checks that newSTH's tree is an append-only
+// extension of oldSTH's, given cp.
+func VerifyConsistency(cfg HashConfig, oldSTH, newSTH SignedTreeHead, cp ConsistencyProof) bool {
+	m, n := oldSTH.TreeSize, newSTH.TreeSize
+	if m == 0 || m > n {
+		return false
+	}
+	if m == n {
+		return len(cp) == 0 && bytes.Equal(oldSTH.RootHash, newSTH.RootHash)
+	}
+	fn, sn, err := verifyConsistencySub(cfg, []hashid.HashId(cp), m, n, true, oldSTH.RootHash)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(fn, oldSTH.RootHash) && bytes.Equal(sn, newSTH.RootHash)
+}
+
+// verifyConsistencySub mirrors MerkleLog.subProof's recursion exactly,
+// consuming one hash off the end of proof per level, to recompute both
+// the old tree's root (fn) and the corresponding subtree of the new tree
+// (sn) that subProof was built from. oldRoot is the caller's own trusted
+// old root hash: subProof omits it from the wire proof at the m==n, b==true
+// base case precisely because the verifier is assumed to already hold it,
+// so it has to be substituted back in here rather than left nil.
+func verifyConsistencySub(cfg HashConfig, proof []hashid.HashId, m, n uint64, b bool, oldRoot hashid.HashId) (fn, sn hashid.HashId, err error) {
+	c := hashContext{cfg: cfg}
+	if m == n {
+		if b {
+			return oldRoot, oldRoot, nil
+		}
+		if len(proof) != 1 {
+			return nil, nil, errors.New("merklelog: malformed consistency proof")
+		}
+		return proof[0], proof[0], nil
+	}
+	if len(proof) == 0 {
+		return nil, nil, errors.New("merklelog: consistency proof too short")
+	}
+	k := largestPowerOfTwoLessThan(n)
+	sib := proof[len(proof)-1]
+	rest := proof[:len(proof)-1]
+	if m <= k {
+		fn0, sn0, err := verifyConsistencySub(cfg, rest, m, k, b, oldRoot)
+		if err != nil {
+			return nil, nil, err
+		}
+		// The old part lies wholly in the left child, so its hash is fn0
+		// unchanged; only the new subtree takes sib as its right child.
+		return fn0, c.hashNode(nil, sn0, sib), nil
+	}
+	fn0, sn0, err := verifyConsistencySub(cfg, rest, m-k, n-k, false, oldRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.hashNode(nil, sib, fn0), c.hashNode(nil, sib, sn0), nil
+}
@@ -0,0 +1,69 @@
+package proof
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/dedis/cothority/lib/hashid"
+)
+
+func TestMerkleLogConsistency(t *testing.T) {
+	cfg := DefaultHashConfig(sha256.New)
+	log := NewMerkleLog(cfg, NewMemoryLogStorage(), 0)
+
+	const nentries = 20
+	sths := make([]SignedTreeHead, nentries+1)
+	sths[0] = SignedTreeHead{TreeSize: 0, RootHash: hashid.HashId(nil)}
+	for i := 0; i < nentries; i++ {
+		_, sth, err := log.Append([]byte{byte(i)})
+		if err != nil {
+			t.Fatalf("Append(%d): %v", i, err)
+		}
+		sths[i+1] = sth
+	}
+
+	for oldSize := uint64(1); oldSize <= nentries; oldSize++ {
+		for newSize := oldSize; newSize <= nentries; newSize++ {
+			cp, err := log.ConsistencyProof(oldSize, newSize)
+			if err != nil {
+				t.Fatalf("ConsistencyProof(%d, %d): %v", oldSize, newSize, err)
+			}
+			if !VerifyConsistency(cfg, sths[oldSize], sths[newSize], cp) {
+				t.Errorf("VerifyConsistency(%d, %d) failed, want success", oldSize, newSize)
+			}
+		}
+	}
+}
+
+func TestMerkleLogConsistencyTamper(t *testing.T) {
+	cfg := DefaultHashConfig(sha256.New)
+	log := NewMerkleLog(cfg, NewMemoryLogStorage(), 0)
+
+	var sths []SignedTreeHead
+	sths = append(sths, SignedTreeHead{TreeSize: 0})
+	for i := 0; i < 8; i++ {
+		_, sth, err := log.Append([]byte{byte(i)})
+		if err != nil {
+			t.Fatalf("Append(%d): %v", i, err)
+		}
+		sths = append(sths, sth)
+	}
+
+	cp, err := log.ConsistencyProof(3, 8)
+	if err != nil {
+		t.Fatalf("ConsistencyProof: %v", err)
+	}
+	if !VerifyConsistency(cfg, sths[3], sths[8], cp) {
+		t.Fatal("untampered proof failed to verify")
+	}
+
+	if len(cp) == 0 {
+		t.Fatal("expected a non-empty proof for this size pair")
+	}
+	tampered := append(ConsistencyProof{}, cp...)
+	tampered[0] = append(hashid.HashId{}, tampered[0]...)
+	tampered[0][0] ^= 0xff
+	if VerifyConsistency(cfg, sths[3], sths[8], tampered) {
+		t.Fatal("tampered consistency proof verified successfully")
+	}
+}
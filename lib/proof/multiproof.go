@@ -0,0 +1,204 @@
+package proof
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/dedis/cothority/lib/hashid"
+)
+
+// MultiProof is a compact Merkle inclusion proof covering an arbitrary
+// subset of the leaves in a single tree. Unlike running Proof.Check once
+// per leaf, a MultiProof carries only the sibling hashes that cannot be
+// derived from the requested leaves themselves (as in Ethereum's
+// GetProofsV2-style trie proofs), so verifying k out of n leaves costs
+// O(k log(n/k)) hash operations instead of O(k log n).
+type MultiProof struct {
+	Indices []int           // indices of the requested leaves, ascending, deduped
+	NLeaves int             // total number of leaves the tree was built over (unpadded)
+	Hashes  []hashid.HashId // sibling hashes not derivable from the requested leaves, level by level
+}
+
+// neededIndices computes, for each tree level from the leaves (level 0) up
+// to the root (level depth), the set of node indices at that level that
+// are ancestors of (or are themselves) one of the requested leaves.
+// Sets are returned as sorted slices so that both the prover and the
+// verifier iterate them in the same order.
+func neededIndices(indices []int, depth int) [][]int {
+	levels := make([][]int, depth+1)
+	cur := append([]int{}, indices...)
+	levels[0] = dedupSorted(cur)
+	for l := 0; l < depth; l++ {
+		next := make([]int, len(levels[l]))
+		for i, idx := range levels[l] {
+			next[i] = idx >> 1
+		}
+		levels[l+1] = dedupSorted(next)
+	}
+	return levels
+}
+
+func dedupSorted(idx []int) []int {
+	// insertion sort: the inputs here are always small (proof-sized)
+	for i := 1; i < len(idx); i++ {
+		for j := i; j > 0 && idx[j-1] > idx[j]; j-- {
+			idx[j-1], idx[j] = idx[j], idx[j-1]
+		}
+	}
+	out := idx[:0]
+	for i, v := range idx {
+		if i == 0 || v != out[len(out)-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func contains(sorted []int, v int) bool {
+	for _, x := range sorted {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ProofTreeMulti builds a Merkle tree over leaves the same way ProofTree
+// does (domain-separated leaf/node hashing, fixed child order) and
+// returns the root together with a single MultiProof covering exactly the
+// requested indices. indices must all be in [0, len(leaves)); out-of-range
+// or negative indices return an error instead of panicking.
+func ProofTreeMulti(cfg HashConfig, leaves []hashid.HashId, indices []int) (hashid.HashId, MultiProof, error) {
+	nleavesArg := len(leaves)
+	for _, idx := range indices {
+		if idx < 0 || idx >= nleavesArg {
+			return nil, MultiProof{}, errors.New("proof: requested index out of range")
+		}
+	}
+	if nleavesArg == 0 {
+		return hashid.HashId(""), MultiProof{}, nil
+	}
+	depth := 0
+	for n := 1; n < nleavesArg; n <<= 1 {
+		depth++
+	}
+	npadded := 1 << uint(depth)
+
+	c := hashContext{cfg: cfg}
+	tree := make([][]hashid.HashId, depth+1)
+	level := make([]hashid.HashId, npadded)
+	for i := 0; i < npadded; i++ {
+		if i < nleavesArg {
+			level[i] = c.hashLeaf(nil, leaves[i])
+		} else {
+			level[i] = c.hashLeaf(nil, nil)
+		}
+	}
+	tree[depth] = level
+	for d := depth - 1; d >= 0; d-- {
+		prev := tree[d+1]
+		next := make([]hashid.HashId, len(prev)/2)
+		for i := range next {
+			next[i] = c.hashNode(nil, prev[i*2], prev[i*2+1])
+		}
+		tree[d] = next
+	}
+	root := tree[0][0]
+
+	reqIdx := dedupSorted(append([]int{}, indices...))
+	levels := neededIndices(reqIdx, depth)
+
+	var proofHashes []hashid.HashId
+	for l := 0; l < depth; l++ {
+		needed := levels[l]
+		treeLevel := tree[depth-l]
+		for _, parent := range levels[l+1] {
+			c0, c1 := parent*2, parent*2+1
+			has0, has1 := contains(needed, c0), contains(needed, c1)
+			if has0 && !has1 {
+				proofHashes = append(proofHashes, treeLevel[c1])
+			} else if has1 && !has0 {
+				proofHashes = append(proofHashes, treeLevel[c0])
+			}
+			// if both are needed, no sibling hash is required here
+		}
+	}
+
+	return root, MultiProof{Indices: reqIdx, NLeaves: nleavesArg, Hashes: proofHashes}, nil
+}
+
+// Check verifies that leaves[i] is the leaf at mp.Indices[i] in the tree
+// committed to by root, using only the sibling hashes carried in mp.
+// leaves must be the raw (un-tagged) leaf contents, in the same order as
+// mp.Indices; they are hashed with the leaf tag here, exactly as
+// ProofTreeMulti hashes the leaves it is given.
+//
+// An out-of-range or negative index in mp.Indices is treated as a failed
+// proof (false) rather than panicking, the same way a malformed Proof
+// fails Proof.Check instead of crashing the caller.
+func (mp MultiProof) Check(cfg HashConfig, root hashid.HashId, leaves []hashid.HashId) bool {
+	if len(leaves) != len(mp.Indices) {
+		return false
+	}
+	if mp.NLeaves == 0 {
+		return len(root) == 0
+	}
+	for _, idx := range mp.Indices {
+		if idx < 0 || idx >= mp.NLeaves {
+			return false
+		}
+	}
+	depth := 0
+	for n := 1; n < mp.NLeaves; n <<= 1 {
+		depth++
+	}
+
+	c := hashContext{cfg: cfg}
+	levels := neededIndices(mp.Indices, depth)
+
+	cur := make(map[int]hashid.HashId, len(mp.Indices))
+	for i, idx := range mp.Indices {
+		cur[idx] = c.hashLeaf(nil, leaves[i])
+	}
+
+	next := append([]hashid.HashId{}, mp.Hashes...)
+	pop := func() hashid.HashId {
+		if len(next) == 0 {
+			return nil
+		}
+		h := next[0]
+		next = next[1:]
+		return h
+	}
+
+	for l := 0; l < depth; l++ {
+		needed := levels[l]
+		parent := make(map[int]hashid.HashId, len(levels[l+1]))
+		for _, p := range levels[l+1] {
+			c0, c1 := p*2, p*2+1
+			has0, has1 := contains(needed, c0), contains(needed, c1)
+			switch {
+			case has0 && has1:
+				parent[p] = c.hashNode(nil, cur[c0], cur[c1])
+			case has0:
+				sib := pop()
+				if sib == nil {
+					return false
+				}
+				parent[p] = c.hashNode(nil, cur[c0], sib)
+			case has1:
+				sib := pop()
+				if sib == nil {
+					return false
+				}
+				parent[p] = c.hashNode(nil, sib, cur[c1])
+			}
+		}
+		cur = parent
+	}
+
+	if len(next) != 0 {
+		return false
+	}
+	return bytes.Equal(cur[0], root)
+}
@@ -1,99 +1,174 @@
 package proof
 
 import (
-	"bytes"
 	"crypto/subtle"
 	"errors"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
-	"github.com/dedis/crypto/abstract"
 	"github.com/dedis/cothority/lib/hashid"
+	"golang.org/x/crypto/sha3"
 	"hash"
 	"strconv"
 )
 
 type HashFunc func() hash.Hash
 
+// RFC 6962 domain-separation tags, prefixed to the hashed data so that a
+// leaf hash can never be mistaken for (or substituted for) an internal
+// node hash, closing the second-preimage attack that affects naively
+// constructed Merkle trees.
+const (
+	leafTag byte = 0x00
+	nodeTag byte = 0x01
+)
+
+// HashConfig carries everything needed to hash a tree the same way on
+// every machine that needs to interoperate: the underlying hash
+// constructor, and the leaf/node domain-separation tags. Two deployments
+// using different HashConfigs (e.g. one on SHA-256, one on SHAKE256-64)
+// are intentionally *not* interoperable - that's the point of the tags.
+type HashConfig struct {
+	NewHash HashFunc // underlying hash constructor
+	LeafTag byte     // prefixed to leaf hashes; RFC 6962 uses 0x00
+	NodeTag byte     // prefixed to internal-node hashes; RFC 6962 uses 0x01
+}
+
+// DefaultHashConfig returns the standard RFC 6962 tagging (0x00 for
+// leaves, 0x01 for internal nodes) wrapping newHash.
+func DefaultHashConfig(newHash HashFunc) HashConfig {
+	return HashConfig{NewHash: newHash, LeafTag: leafTag, NodeTag: nodeTag}
+}
+
+// shakeHash adapts a SHAKE256 sponge to the hash.Hash interface with a
+// fixed, caller-chosen output length, so it can be used anywhere a
+// HashFunc is expected.
+type shakeHash struct {
+	sha3.ShakeHash
+	outLen int
+}
+
+func (s *shakeHash) Sum(b []byte) []byte {
+	clone := s.Clone()
+	out := make([]byte, s.outLen)
+	clone.Read(out)
+	return append(b, out...)
+}
+
+func (s *shakeHash) Size() int { return s.outLen }
+
+// Shake256 returns a HashFunc producing SHAKE256 digests of outLen bytes.
+// outLen is typically 32 or 64, chosen to match the security level the
+// deployment wants; the two are not compatible with each other since the
+// output length is itself part of the commitment.
+func Shake256(outLen int) HashFunc {
+	return func() hash.Hash {
+		return &shakeHash{ShakeHash: sha3.NewShake256(), outLen: outLen}
+	}
+}
+
 // Proof-of-beforeness:
 // a list of offsets of peer-hash-pointers at each level below the root.
 
+// ProofStep is one level of a Merkle inclusion proof: the sibling hash at
+// that level, and whether that sibling is the left or right child of
+// their shared parent. Recording the side is what lets Calc rebuild the
+// root with the leaf pinned to its original position, rather than
+// reordering left/right by hash value as earlier versions did.
+type ProofStep struct {
+	Hash hashid.HashId
+	Left bool // true if Hash is the left sibling (the proved node is the right one)
+}
+
 // Proof is used for Local Merkle Trees (computed based on messages from clients)
 // One Proof sufficient for one leaf in a Local Merkle Tree
-type Proof []hashid.HashId
+type Proof []ProofStep
 
 // LevelProof is used for the Big Merkle Tree (computed from server commits)
 // A []LevelProof from root to server is sufficient proof
 type LevelProof []hashid.HashId
 
 type hashContext struct {
-	newHash func() hash.Hash
-	hash    hash.Hash
+	cfg  HashConfig
+	hash hash.Hash
 }
 
-func (c *hashContext) hashNode(buf []byte, left, right hashid.HashId) []byte {
-	if bytes.Compare(left, right) > 0 {
-		left, right = right, left
-	}
+func (c *hashContext) reset() hash.Hash {
 	if c.hash == nil {
-		c.hash = c.newHash()
+		c.hash = c.cfg.NewHash()
 	} else {
 		c.hash.Reset()
 	}
-	h := c.hash
+	return c.hash
+}
+
+// hashLeaf computes H(LeafTag || leaf), the domain-separated hash of a
+// tree leaf.
+func (c *hashContext) hashLeaf(buf []byte, leaf []byte) []byte {
+	h := c.reset()
+	h.Write([]byte{c.cfg.LeafTag})
+	h.Write(leaf)
+	return h.Sum(buf)
+}
 
+// hashNode computes H(NodeTag || left || right), the domain-separated
+// hash of an internal node. Unlike the original implementation, left and
+// right are never swapped: preserving their order is what lets a Proof
+// encode (and a verifier reconstruct) the leaf's position in the tree.
+func (c *hashContext) hashNode(buf []byte, left, right hashid.HashId) []byte {
+	h := c.reset()
+	h.Write([]byte{c.cfg.NodeTag})
 	h.Write(left)
 	h.Write(right)
-
-	s := h.Sum(buf)
-	return s
+	return h.Sum(buf)
 }
 
 // Given a Proof and the hash of the leaf, compute the hash of the root.
-// If the Proof is of length 0, simply returns leaf.
-func (p Proof) Calc(newHash HashFunc, leaf []byte) []byte {
-	c := hashContext{newHash: newHash}
-	var buf []byte
+// If the Proof is of length 0, simply returns the leaf hash.
+func (p Proof) Calc(cfg HashConfig, leaf []byte) []byte {
+	c := hashContext{cfg: cfg}
+	cur := c.hashLeaf(nil, leaf)
 	for i := len(p) - 1; i >= 0; i-- {
-		leaf = c.hashNode(buf[:0], leaf, p[i])
-		buf = leaf
+		step := p[i]
+		if step.Left {
+			cur = c.hashNode(nil, step.Hash, cur)
+		} else {
+			cur = c.hashNode(nil, cur, step.Hash)
+		}
 	}
-	return leaf
+	return cur
 }
 
 // Check a purported Proof against given root and leaf hashes.
-func (p Proof) Check(newHash HashFunc, root, leaf []byte) bool {
-	chk := p.Calc(newHash, leaf)
+func (p Proof) Check(cfg HashConfig, root, leaf []byte) bool {
+	chk := p.Calc(cfg, leaf)
 	// compare returns 1 if equal, so return is true when check is good
-	// log.Println(chk, root)
 	return subtle.ConstantTimeCompare(chk, root) != 0
 }
 
-func CheckProof(newHash HashFunc, root hashid.HashId, leaf hashid.HashId, proof Proof) bool {
-	// log.Println("Root", len(root), root)
-	// log.Println("Leaf", len(leaf), leaf)
-	// log.Println("Proof", proof)
-	// log.Println("\n")
-	if proof.Check(newHash, root, leaf) == false {
+func CheckProof(cfg HashConfig, root hashid.HashId, leaf hashid.HashId, proof Proof) bool {
+	if proof.Check(cfg, root, leaf) == false {
 		log.Errorln("FAILED TO CHECK")
 		panic("check failed at leaf")
 	}
 	return true
 }
 
-func CheckLocalProofs(newHash HashFunc, root hashid.HashId, leaves []hashid.HashId, proofs []Proof) bool {
-	// fmt.Println("Created mtRoot:", mtRoot)
-
+// CheckLocalProofs checks a purported set of per-leaf Proofs against root,
+// one leaf at a time. If mp is non-nil, proofs is ignored and mp - a
+// single MultiProof - is checked against leaves in one pass instead,
+// which is cheaper when a signer has just committed to many client
+// leaves at once. Passing mp does not by itself guarantee every leaf the
+// signer committed to was checked: that's only true if mp.Indices
+// actually covers all of them, which is the caller's responsibility.
+func CheckLocalProofs(cfg HashConfig, root hashid.HashId, leaves []hashid.HashId, proofs []Proof, mp *MultiProof) bool {
+	if mp != nil {
+		if !mp.Check(cfg, root, leaves) {
+			panic("multiproof check failed")
+		}
+		return true
+	}
 	for i := range proofs {
-		// log.Println("Root", root)
-		// log.Println("Leaf", leaves[i])
-		// log.Println("Proof", proofs[i])
-		// log.Println("\n")
-		// log.Println("root", root)
-		// log.Println("proofs[i]", proofs[i])
-		// if root == nil {
-		// 	continue
-		// }
-		if proofs[i].Check(newHash, root, leaves[i]) == false {
+		if proofs[i].Check(cfg, root, leaves[i]) == false {
 			panic("check failed at leaf" + strconv.Itoa(i))
 		}
 	}
@@ -102,10 +177,9 @@ func CheckLocalProofs(newHash HashFunc, root hashid.HashId, leaves []hashid.Hash
 
 func (p *Proof) PrintProof(proofNumber int) {
 	fmt.Println("Proof number=", proofNumber)
-	for _, x := range *p {
-		fmt.Println(x)
+	for _, step := range *p {
+		fmt.Println(step.Hash, "left=", step.Left)
 	}
-	// 	fmt.Println("\n")
 }
 
 func PrintProofs(proofs []Proof) {
@@ -123,7 +197,13 @@ func sibling(i int) int {
 
 // Generate a Merkle proof tree for the given list of leaves,
 // yielding one output proof per leaf.
-func ProofTree(newHash func() hash.Hash, leaves []hashid.HashId) (hashid.HashId, []Proof) {
+//
+// Leaves are hashed with the leaf domain-separation tag before being
+// placed in the tree, and internal nodes are hashed with the node tag in
+// fixed left/right order (RFC 6962 style), so a leaf hash can never be
+// mistaken for an internal node hash and a proof always pins its leaf to
+// a specific position.
+func ProofTree(cfg HashConfig, leaves []hashid.HashId) (hashid.HashId, []Proof) {
 	if len(leaves) == 0 {
 		return hashid.HashId(""), nil
 	}
@@ -134,24 +214,27 @@ func ProofTree(newHash func() hash.Hash, leaves []hashid.HashId) (hashid.HashId,
 		depth++
 	}
 
-	// if nleaves is not a power of 2, we add 0s to fill in up to pow2
+	c := hashContext{cfg: cfg}
+
+	// Hash every leaf with the leaf tag; if nleaves is not a power of 2,
+	// pad out to the next power of 2 with hashes of the empty string.
 	var i int
+	hashedLeaves := make([]hashid.HashId, 0, 1<<uint(depth))
+	for i = 0; i < nleavesArg; i++ {
+		hashedLeaves = append(hashedLeaves, c.hashLeaf(nil, leaves[i]))
+	}
 	for nleaves, i = (1 << uint(depth)), nleavesArg; i < nleaves; i++ {
-		leaves = append(leaves, make([]byte, newHash().Size()))
+		hashedLeaves = append(hashedLeaves, c.hashLeaf(nil, nil))
 	}
-	// fmt.Println("depth=", depth, "nleaves=", nleavesArg)
 
 	// Build the Merkle tree
-	c := hashContext{newHash: newHash}
 	tree := make([][]hashid.HashId, depth+1)
-	tree[depth] = leaves
+	tree[depth] = hashedLeaves
 	nprev := nleaves
 	tprev := tree[depth]
 	for d := depth - 1; d >= 0; d-- {
 		nnext := (nprev + 1) >> 1 // # hashes total at level i
 		nnode := nprev >> 1       // # new nodes at level i
-		// println("nprev", nprev, "nnext", nnext, "nnode", nnode)
-		// fmt.Println("nprev", nprev, "nnext", nnext, "nnode", nnode)
 		tree[d] = make([]hashid.HashId, nnext)
 		tnext := tree[d]
 		for i := 0; i < nnode; i++ {
@@ -170,15 +253,15 @@ func ProofTree(newHash func() hash.Hash, leaves []hashid.HashId) (hashid.HashId,
 	// Some towards the end may end up being shorter than depth.
 	proofs := make([]Proof, nleaves)
 	for i := 0; i < nleaves; i++ {
-		p := make([]hashid.HashId, 0, depth)
-		// p = append(p, root)
+		p := make(Proof, 0, depth)
 		for d := depth - 1; d >= 0; d-- {
-			h := tree[depth-d][sibling(i>>uint(d))]
+			idx := i >> uint(d)
+			h := tree[depth-d][sibling(idx)]
 			if h != nil {
-				p = append(p, h)
+				p = append(p, ProofStep{Hash: h, Left: idx&1 == 1})
 			}
 		}
-		proofs[i] = Proof(p)
+		proofs[i] = p
 	}
 	return root, proofs[:nleavesArg]
 }
@@ -198,15 +281,16 @@ type MerklePath struct {
 // validating the entire path in the process.
 // Returns a slice of a buffer obtained from HashGet.Get(),
 // which might be shared and should be considered read-only.
-func MerkleGet(suite abstract.Suite, root []byte, path MerklePath,
+func MerkleGet(cfg HashConfig, root []byte, path MerklePath,
 	ctx hashid.HashGet) ([]byte, error) {
 
+	hashLen := cfg.NewHash().Size()
+
 	// Follow pointers through intermediate levels
 	blob := root
 	for i := range path.Ptr {
 		beg := path.Ptr[i]
-		// end := beg + suite.HashLen()
-		end := beg + 256 // change me: find hash len
+		end := beg + hashLen
 		if end > len(blob) {
 			return nil, errors.New("bad Merkle tree pointer offset")
 		}
@@ -226,6 +310,3 @@ func MerkleGet(suite abstract.Suite, root []byte, path MerklePath,
 	}
 	return blob[beg:end], nil
 }
-
-//type MerkleLog struct {
-//}
@@ -0,0 +1,96 @@
+package proof
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/dedis/cothority/lib/hashid"
+)
+
+func TestProofTreeRoundTrip(t *testing.T) {
+	cfg := DefaultHashConfig(sha256.New)
+	for _, n := range []int{1, 2, 3, 4, 5, 8, 9, 16, 17, 37} {
+		leaves := genLeaves(n, int64(n))
+		root, proofs := ProofTree(cfg, leaves)
+		if len(proofs) != n {
+			t.Fatalf("n=%d: got %d proofs, want %d", n, len(proofs), n)
+		}
+		for i, p := range proofs {
+			if !p.Check(cfg, root, leaves[i]) {
+				t.Errorf("n=%d: proof for leaf %d failed to check", n, i)
+			}
+		}
+	}
+}
+
+func TestProofTreeTamperDetection(t *testing.T) {
+	cfg := DefaultHashConfig(sha256.New)
+	leaves := genLeaves(9, 11)
+	root, proofs := ProofTree(cfg, leaves)
+
+	// Tampered leaf content.
+	tampered := append(hashid.HashId{}, leaves[3]...)
+	tampered[0] ^= 0xff
+	if proofs[3].Check(cfg, root, tampered) {
+		t.Error("Proof.Check succeeded against a tampered leaf")
+	}
+
+	// Tampered proof step.
+	tamperedProof := append(Proof{}, proofs[3]...)
+	tamperedProof[0].Hash = append(hashid.HashId{}, tamperedProof[0].Hash...)
+	tamperedProof[0].Hash[0] ^= 0xff
+	if tamperedProof.Check(cfg, root, leaves[3]) {
+		t.Error("Proof.Check succeeded against a tampered proof step")
+	}
+
+	// Wrong root entirely.
+	wrongRoot := append(hashid.HashId{}, root...)
+	wrongRoot[0] ^= 0xff
+	if proofs[3].Check(cfg, wrongRoot, leaves[3]) {
+		t.Error("Proof.Check succeeded against the wrong root")
+	}
+}
+
+// A leaf hash must never collide with a node hash of the same bytes: that
+// domain separation is what stops an attacker from passing off an internal
+// node as if it were a leaf (the classic second-preimage attack on naive
+// Merkle trees).
+func TestHashDomainSeparation(t *testing.T) {
+	cfg := DefaultHashConfig(sha256.New)
+	c := hashContext{cfg: cfg}
+	data := []byte("some-tree-content")
+
+	leafHash := c.hashLeaf(nil, data)
+	nodeHash := c.hashNode(nil, hashid.HashId(data[:len(data)/2]), hashid.HashId(data[len(data)/2:]))
+	if string(leafHash) == string(nodeHash) {
+		t.Fatal("leaf hash and node hash of related content collided")
+	}
+
+	// More directly: hashing the same bytes as a leaf vs. as the left
+	// half of a node (with an empty right half) must differ.
+	nodeHash2 := c.hashNode(nil, hashid.HashId(data), hashid.HashId(nil))
+	leafHash2 := c.hashLeaf(nil, data)
+	if string(leafHash2) == string(nodeHash2) {
+		t.Fatal("leaf tag and node tag produced the same hash for the same payload")
+	}
+}
+
+// A Proof is only valid for the leaf at the position it was generated for;
+// swapping in a different leaf at that same index (even one that's also a
+// valid leaf of the tree) must fail.
+func TestProofPositionSensitivity(t *testing.T) {
+	cfg := DefaultHashConfig(sha256.New)
+	leaves := genLeaves(6, 13)
+	root, proofs := ProofTree(cfg, leaves)
+
+	for i := range leaves {
+		for j := range leaves {
+			if i == j {
+				continue
+			}
+			if proofs[i].Check(cfg, root, leaves[j]) {
+				t.Errorf("proof for position %d wrongly checked out for leaf at position %d", i, j)
+			}
+		}
+	}
+}